@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"sync"
 
 	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
@@ -22,15 +23,32 @@ type ShareState struct {
 	rootHash []byte
 	trie     *merkle.IAVLTree
 
+	// beaconRound is the drand-style round last stored with
+	// RecordBeaconRound. It is held in memory only: Commit does not write it
+	// into the trie, and ElectValidators neither reads nor sets it.
+	beaconRound uint64
+
+	// stakeValueFunc and maxActiveShares back QueryShare/Iterate; both
+	// default to historical behaviour (stake == balance, 64 active shares)
+	// when left unset.
+	stakeValueFunc  StakeValueFunc
+	maxActiveShares int
+
+	// versions maps a committed height to the rootHash CommitAt produced
+	// there, letting LoadVersion/RootAt/PruneVersionIndex reconstruct or
+	// forget history.
+	versions map[def.INT][]byte
+
 	//key is ed25519 pubkey
 	ShareCache *mlist.MapList
 }
 
 type Share struct {
-	Pubkey        []byte
-	ShareBalance  *big.Int
-	ShareGuaranty *big.Int
-	MHeight       def.INT
+	Pubkey         []byte
+	ControlAddress []byte
+	ShareBalance   *big.Int
+	ShareGuaranty  *big.Int
+	MHeight        def.INT
 }
 
 func NewShareState(database db.DB) *ShareState {
@@ -95,7 +113,11 @@ func (ps *ShareState) GetShare(pubkey []byte) (*Share, error) {
 	return nil, fmt.Errorf("Share not exist: %X", pubkey)
 }
 
-func (ps *ShareState) QueryShare(pubkey crypto.PubKey) (*big.Int, def.INT) {
+// QueryShare returns a share's voting stake at height and its MHeight. The
+// stake is computed through the ShareState's StakeValueFunc (see
+// SetStakeValueFunc), which defaults to the historical "stake == balance"
+// behaviour, so existing callers see no change until they install a curve.
+func (ps *ShareState) QueryShare(pubkey crypto.PubKey, height def.INT) (*big.Int, def.INT) {
 	keystring := pubkey.KeyString()
 	ps.Lock()
 	defer ps.Unlock()
@@ -103,7 +125,7 @@ func (ps *ShareState) QueryShare(pubkey crypto.PubKey) (*big.Int, def.INT) {
 	// from cache
 	if itfc, ok := ps.ShareCache.Get(keystring); ok {
 		pwr := itfc.(*Share)
-		return pwr.ShareBalance, pwr.MHeight
+		return ps.stakeFunc()(pwr, height), pwr.MHeight
 	}
 
 	// from db
@@ -114,7 +136,7 @@ func (ps *ShareState) QueryShare(pubkey crypto.PubKey) (*big.Int, def.INT) {
 			log.Println(err)
 			return big0, 0
 		}
-		return pwr.ShareBalance, pwr.MHeight
+		return ps.stakeFunc()(pwr, height), pwr.MHeight
 	}
 
 	return big0, 0
@@ -127,14 +149,32 @@ func (ps *ShareState) AddShareBalance(pubkey crypto.PubKey, amount *big.Int, hei
 
 	// from cache
 	if itfc, ok := ps.ShareCache.Get(keystring); ok {
-		pwr := itfc.(*Share)
-		pwr.ShareBalance = new(big.Int).Add(pwr.ShareBalance, amount)
-		pwr.MHeight = height
-		return nil
+		switch entry := itfc.(type) {
+		case *Share:
+			entry.ShareBalance = new(big.Int).Add(entry.ShareBalance, amount)
+			entry.MHeight = height
+			return nil
+		case *GroupShare:
+			entry.ShareBalance = new(big.Int).Add(entry.ShareBalance, amount)
+			entry.MHeight = height
+			return nil
+		default:
+			return fmt.Errorf("unexpected cache entry type for %s: %T", keystring, itfc)
+		}
 	}
 
 	// from db
 	if _, value, exist := ps.trie.Get([]byte(keystring)); exist {
+		if strings.HasPrefix(keystring, groupSharePrefix) {
+			gs := new(GroupShare)
+			if err := gs.FromBytes(value); err != nil {
+				return err
+			}
+			gs.ShareBalance = new(big.Int).Add(gs.ShareBalance, amount)
+			gs.MHeight = height
+			ps.ShareCache.Set(keystring, gs)
+			return nil
+		}
 		pwr := new(Share)
 		err := pwr.FromBytes(value)
 		if err != nil {
@@ -147,13 +187,20 @@ func (ps *ShareState) AddShareBalance(pubkey crypto.PubKey, amount *big.Int, hei
 	}
 
 	// new account
-	pk := pubkey.(*crypto.PubKeyEd25519)
+	if _, ok := pubkey.(GroupPubKey); ok {
+		ps.ShareCache.Set(keystring, &GroupShare{
+			GroupPubkey:  pubkeyBytes(pubkey),
+			ShareBalance: amount,
+			MHeight:      height,
+		})
+		return nil
+	}
 	pwr := &Share{
-		Pubkey:       pk[:],
+		Pubkey:       pubkeyBytes(pubkey),
 		ShareBalance: amount,
 		MHeight:      height,
 	}
-	ps.ShareCache.Set(pk.KeyString(), pwr)
+	ps.ShareCache.Set(keystring, pwr)
 	return nil
 }
 
@@ -164,17 +211,40 @@ func (ps *ShareState) SubShareBalance(pubkey crypto.PubKey, amount *big.Int, hei
 
 	// from cache
 	if itfc, ok := ps.ShareCache.Get(keystring); ok {
-		pwr := itfc.(*Share)
-		if pwr.ShareBalance.Cmp(amount) >= 0 {
-			pwr.ShareBalance = new(big.Int).Sub(pwr.ShareBalance, amount)
-			// pwr.MHeight = height
-			return nil
+		switch entry := itfc.(type) {
+		case *Share:
+			if entry.ShareBalance.Cmp(amount) >= 0 {
+				entry.ShareBalance = new(big.Int).Sub(entry.ShareBalance, amount)
+				// entry.MHeight = height
+				return nil
+			}
+			return errors.New("insufficent ShareBalance to sub")
+		case *GroupShare:
+			if entry.ShareBalance.Cmp(amount) >= 0 {
+				entry.ShareBalance = new(big.Int).Sub(entry.ShareBalance, amount)
+				// entry.MHeight = height
+				return nil
+			}
+			return errors.New("insufficent ShareBalance to sub")
+		default:
+			return fmt.Errorf("unexpected cache entry type for %s: %T", keystring, itfc)
 		}
-		return errors.New("insufficent ShareBalance to sub")
 	}
 
 	// from db
 	if _, value, exist := ps.trie.Get([]byte(keystring)); exist {
+		if strings.HasPrefix(keystring, groupSharePrefix) {
+			gs := new(GroupShare)
+			if err := gs.FromBytes(value); err != nil {
+				return err
+			}
+			if gs.ShareBalance.Cmp(amount) >= 0 {
+				gs.ShareBalance = new(big.Int).Sub(gs.ShareBalance, amount)
+				ps.ShareCache.Set(keystring, gs)
+				return nil
+			}
+			return errors.New("insufficent ShareBalance to sub")
+		}
 		pwr := new(Share)
 		err := pwr.FromBytes(value)
 		if err != nil {
@@ -200,13 +270,29 @@ func (ps *ShareState) MarkShare(pubkey crypto.PubKey, mValue def.INT) error {
 
 	// from cache
 	if itfc, ok := ps.ShareCache.Get(keystring); ok {
-		pwr := itfc.(*Share)
-		pwr.MHeight = mValue
-		return nil
+		switch entry := itfc.(type) {
+		case *Share:
+			entry.MHeight = mValue
+			return nil
+		case *GroupShare:
+			entry.MHeight = mValue
+			return nil
+		default:
+			return fmt.Errorf("unexpected cache entry type for %s: %T", keystring, itfc)
+		}
 	}
 
 	// from db
 	if _, value, exist := ps.trie.Get([]byte(keystring)); exist {
+		if strings.HasPrefix(keystring, groupSharePrefix) {
+			gs := new(GroupShare)
+			if err := gs.FromBytes(value); err != nil {
+				return err
+			}
+			gs.MHeight = mValue
+			ps.ShareCache.Set(keystring, gs)
+			return nil
+		}
 		pwr := new(Share)
 		err := pwr.FromBytes(value)
 		if err != nil {
@@ -225,17 +311,32 @@ func (ps *ShareState) Commit() ([]byte, error) {
 	ps.mtx.Lock()
 	defer ps.mtx.Unlock()
 
+	ps.flushCacheLocked()
+	ps.rootHash = ps.trie.Save()
+	return ps.rootHash, nil
+}
+
+// flushCacheLocked writes every pending ShareCache entry into the trie
+// without saving it, i.e. the part of Commit that CommitAt and
+// PruneVersionIndex also run first so they never see stale cached mutations.
+// Callers must hold ps.mtx.
+func (ps *ShareState) flushCacheLocked() {
 	ps.ShareCache.Exec(func(k string, v interface{}) {
-		pwr := v.(*Share)
-		if pwr.ShareBalance.Cmp(big0) == 0 {
-			ps.trie.Remove([]byte(k))
-		} else {
-			ps.trie.Set([]byte(k), pwr.ToBytes())
+		switch pwr := v.(type) {
+		case *Share:
+			if pwr.ShareBalance.Cmp(big0) == 0 {
+				ps.trie.Remove([]byte(k))
+			} else {
+				ps.trie.Set([]byte(k), pwr.ToBytes())
+			}
+		case *GroupShare:
+			if pwr.ShareBalance.Cmp(big0) == 0 {
+				ps.trie.Remove([]byte(k))
+			} else {
+				ps.trie.Set([]byte(k), pwr.ToBytes())
+			}
 		}
 	})
-
-	ps.rootHash = ps.trie.Save()
-	return ps.rootHash, nil
 }
 
 // Load dumps all the buffer, start every thing from a clean state
@@ -256,20 +357,47 @@ func (ps *ShareState) Reload(root []byte) {
 	ps.Unlock()
 }
 
+// Iterate walks plain (ed25519-keyed) Shares only, stopping once it has
+// yielded the ShareState's active-share cap (64 by default, see
+// SetMaxActiveShares) so validator-selection callers don't each have to
+// reimplement that cap themselves. GroupShare entries live in the same
+// cache/trie under the groupSharePrefix namespace and are skipped here
+// rather than mis-decoded as Share (see IterateGroups for those).
 func (ps *ShareState) Iterate(fn func(*Share) bool) {
 	ps.Lock()
 	defer ps.Unlock()
 
+	limit := ps.maxActive()
+	seen := 0
+
 	// Iterate cache first
 	ps.ShareCache.Exec(func(key string, value interface{}) {
-		pwr := value.(*Share)
+		if seen >= limit {
+			return
+		}
+		pwr, ok := value.(*Share)
+		if !ok {
+			return
+		}
 		if pwr.ShareBalance.Cmp(big0) != 0 {
+			seen++
 			fn(pwr)
 		}
 	})
 
+	if seen >= limit {
+		return
+	}
+
 	// Iterate tree
 	ps.trie.Iterate(func(key, value []byte) bool {
+		if seen >= limit {
+			return true
+		}
+		if strings.HasPrefix(string(key), groupSharePrefix) {
+			return false
+		}
+
 		pwr := new(Share)
 		if err := pwr.FromBytes(value); err != nil {
 			fmt.Println("Iterate power state faild:", err.Error())
@@ -283,7 +411,43 @@ func (ps *ShareState) Iterate(fn func(*Share) bool) {
 			return false
 		}
 
-		return fn(pwr)
+		seen++
+		stop := fn(pwr)
+		return stop || seen >= limit
+	})
+}
+
+// IterateGroups walks GroupShare entries only, mirroring Iterate.
+func (ps *ShareState) IterateGroups(fn func(*GroupShare) bool) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	ps.ShareCache.Exec(func(key string, value interface{}) {
+		gs, ok := value.(*GroupShare)
+		if !ok {
+			return
+		}
+		if gs.ShareBalance.Cmp(big0) != 0 {
+			fn(gs)
+		}
+	})
+
+	ps.trie.Iterate(func(key, value []byte) bool {
+		if !strings.HasPrefix(string(key), groupSharePrefix) {
+			return false
+		}
+
+		gs := new(GroupShare)
+		if err := gs.FromBytes(value); err != nil {
+			fmt.Println("IterateGroups failed:", err.Error())
+			return true
+		}
+
+		if _, exist := ps.ShareCache.Get(GroupPubKey(gs.GroupPubkey).KeyString()); exist {
+			return false
+		}
+
+		return fn(gs)
 	})
 }
 
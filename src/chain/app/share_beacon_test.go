@@ -0,0 +1,36 @@
+package app
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-db"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+	"github.com/Baptist-Publication/chorus/src/chain/beacon"
+)
+
+func TestElectValidatorsIsDeterministic(t *testing.T) {
+	ps := NewShareState(db.NewMemDB())
+
+	ps.CreateShare(testPubkey(0x10), big.NewInt(100), def.INT(1))
+	ps.CreateShare(testPubkey(0x20), big.NewInt(50), def.INT(1))
+	ps.CreateShare(testPubkey(0x30), big.NewInt(10), def.INT(1))
+	root, err := ps.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	entry := beacon.BeaconEntry{Round: 7, Signature: []byte("fixed-round-signature")}
+
+	first := ps.ElectValidators(root, entry, 2)
+	second := ps.ElectValidators(root, entry, 2)
+
+	if len(first) != 2 || len(second) != 2 {
+		t.Fatalf("expected 2 winners both times, got %d and %d", len(first), len(second))
+	}
+	for i := range first {
+		if string(first[i].Pubkey) != string(second[i].Pubkey) {
+			t.Fatalf("ElectValidators returned different winners for the same (root, entry, k): %X vs %X", first[i].Pubkey, second[i].Pubkey)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+)
+
+// defaultMaxActiveShares bounds Iterate when the caller hasn't set its own
+// cap with SetMaxActiveShares.
+const defaultMaxActiveShares = 64
+
+// StakeValueFunc computes the voting stake a Share carries, as a function of
+// its balance, guaranty and age. The zero value of ShareState falls back to
+// DefaultStakeValueFunc (stake == balance), preserving today's behaviour;
+// operators that want a non-linear curve install their own before Commit.
+type StakeValueFunc func(share *Share, height def.INT) *big.Int
+
+// DefaultStakeValueFunc reproduces the historical "power == balance"
+// assumption, ignoring ShareGuaranty and age entirely.
+func DefaultStakeValueFunc(share *Share, height def.INT) *big.Int {
+	return new(big.Int).Set(share.ShareBalance)
+}
+
+// SetStakeValueFunc installs fn as the stake curve used by QueryShare.
+// Passing nil restores DefaultStakeValueFunc.
+func (ps *ShareState) SetStakeValueFunc(fn StakeValueFunc) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	ps.stakeValueFunc = fn
+}
+
+func (ps *ShareState) stakeFunc() StakeValueFunc {
+	if ps.stakeValueFunc != nil {
+		return ps.stakeValueFunc
+	}
+	return DefaultStakeValueFunc
+}
+
+// SetMaxActiveShares overrides the cap Iterate enforces. n <= 0 resets it to
+// defaultMaxActiveShares.
+func (ps *ShareState) SetMaxActiveShares(n int) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	ps.maxActiveShares = n
+}
+
+func (ps *ShareState) maxActive() int {
+	if ps.maxActiveShares > 0 {
+		return ps.maxActiveShares
+	}
+	return defaultMaxActiveShares
+}
+
+// getShareLocked looks up a Share by its ed25519 key string from cache or
+// trie, the same way GetShare does. Callers must hold ps.mtx.
+func (ps *ShareState) getShareLocked(keystring string) (*Share, error) {
+	if itfc, ok := ps.ShareCache.Get(keystring); ok {
+		return itfc.(*Share), nil
+	}
+	if _, value, exist := ps.trie.Get([]byte(keystring)); exist {
+		share := new(Share)
+		if err := share.FromBytes(value); err != nil {
+			return nil, err
+		}
+		return share, nil
+	}
+	return nil, fmt.Errorf("Share not exist: %s", keystring)
+}
+
+// SetControlAddress attaches a control address to an existing share, distinct
+// from its consensus Pubkey, and sets the share's MHeight to height.
+// EditShare and RotateSharePubkey do not check the control address.
+func (ps *ShareState) SetControlAddress(pubkey, ctrl []byte, height def.INT) error {
+	keystring := ed25519KeyString(pubkey)
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	share, err := ps.getShareLocked(keystring)
+	if err != nil {
+		return err
+	}
+
+	share.ControlAddress = ctrl
+	share.MHeight = height
+	ps.ShareCache.Set(keystring, share)
+	return nil
+}
+
+// EditShare updates a share's ControlAddress without touching ShareBalance,
+// ShareGuaranty or MHeight's accounting role; pass nil for ctrl to leave it
+// unchanged.
+func (ps *ShareState) EditShare(pubkey []byte, ctrl []byte) error {
+	keystring := ed25519KeyString(pubkey)
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	share, err := ps.getShareLocked(keystring)
+	if err != nil {
+		return err
+	}
+	if ctrl == nil {
+		return nil
+	}
+
+	share.ControlAddress = ctrl
+	ps.ShareCache.Set(keystring, share)
+	return nil
+}
+
+// RotateSharePubkey atomically moves ShareBalance and ShareGuaranty from
+// oldPubkey to newPubkey, sets the new share's MHeight to height and leaves
+// the old share at zero, so a validator can roll its consensus key without
+// losing stake. A newly created share takes over oldPubkey's ControlAddress.
+// sigByOld must
+// be newPubkey signed by oldPubkey, proving the rotation was authorized by
+// the key being retired. sigByOld only proves oldPubkey authorized handing
+// its stake to newPubkey, not that newPubkey is unclaimed, so if a share
+// already sits at newKeystring its balance/guaranty are merged rather than
+// overwritten and it keeps its own ControlAddress, the same conflict handling
+// ReshareGroup uses for GroupShares.
+func (ps *ShareState) RotateSharePubkey(oldPubkey, newPubkey, sigByOld []byte, height def.INT) error {
+	oldPub := crypto.PubKeyEd25519{}
+	copy(oldPub[:], oldPubkey)
+	if !oldPub.VerifyBytes(newPubkey, sigByOld) {
+		return errors.New("RotateSharePubkey: signature by old pubkey does not verify")
+	}
+
+	oldKeystring := ed25519KeyString(oldPubkey)
+	newKeystring := ed25519KeyString(newPubkey)
+	if oldKeystring == newKeystring {
+		return errors.New("RotateSharePubkey: new pubkey is the same as the old one")
+	}
+
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	oldShare, err := ps.getShareLocked(oldKeystring)
+	if err != nil {
+		return err
+	}
+
+	newShare, err := ps.getShareLocked(newKeystring)
+	if err != nil {
+		// not found yet: the rotation mints the new identity
+		newShare = &Share{
+			Pubkey:         append([]byte{}, newPubkey...),
+			ControlAddress: oldShare.ControlAddress,
+			ShareBalance:   big.NewInt(0),
+			ShareGuaranty:  big.NewInt(0),
+		}
+	}
+
+	newShare.ShareBalance = new(big.Int).Add(newShare.ShareBalance, oldShare.ShareBalance)
+	if oldShare.ShareGuaranty != nil {
+		if newShare.ShareGuaranty == nil {
+			newShare.ShareGuaranty = big.NewInt(0)
+		}
+		newShare.ShareGuaranty = new(big.Int).Add(newShare.ShareGuaranty, oldShare.ShareGuaranty)
+	}
+	newShare.MHeight = height
+
+	oldShare.ShareBalance = big.NewInt(0)
+	oldShare.ShareGuaranty = big.NewInt(0)
+
+	ps.ShareCache.Set(oldKeystring, oldShare)
+	ps.ShareCache.Set(newKeystring, newShare)
+	return nil
+}
+
+func ed25519KeyString(pubkey []byte) string {
+	pub := crypto.PubKeyEd25519{}
+	copy(pub[:], pubkey)
+	return pub.KeyString()
+}
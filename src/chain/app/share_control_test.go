@@ -0,0 +1,68 @@
+package app
+
+import (
+	stded25519 "crypto/ed25519"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
+	"github.com/Baptist-Publication/chorus-module/lib/go-db"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+)
+
+func TestRotateSharePubkeyMergesIntoExistingDestination(t *testing.T) {
+	oldPubkey, oldPriv, err := stded25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	newPubkey := testPubkey(0x40)
+
+	privKey := crypto.PrivKeyEd25519{}
+	copy(privKey[:], oldPriv)
+	sigByOld, err := privKey.Sign(newPubkey)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	ps := NewShareState(db.NewMemDB())
+	ps.CreateShare(oldPubkey, big.NewInt(100), def.INT(1))
+	// The destination key already owns a share before the rotation, the way
+	// a validator rotating onto a previously-retired consensus key would.
+	ps.CreateShare(newPubkey, big.NewInt(30), def.INT(1))
+
+	if err := ps.RotateSharePubkey(oldPubkey, newPubkey, sigByOld, 5); err != nil {
+		t.Fatalf("RotateSharePubkey: %v", err)
+	}
+
+	newShare, err := ps.GetShare(newPubkey)
+	if err != nil {
+		t.Fatalf("GetShare(new): %v", err)
+	}
+	if newShare.ShareBalance.Cmp(big.NewInt(130)) != 0 {
+		t.Fatalf("rotation clobbered the destination's balance instead of merging: got %s, want 130", newShare.ShareBalance)
+	}
+
+	oldShare, err := ps.GetShare(oldPubkey)
+	if err != nil {
+		t.Fatalf("GetShare(old): %v", err)
+	}
+	if oldShare.ShareBalance.Sign() != 0 {
+		t.Fatalf("old share still carries balance after rotation: %s", oldShare.ShareBalance)
+	}
+}
+
+func TestRotateSharePubkeyRejectsBadSignature(t *testing.T) {
+	oldPubkey, _, err := stded25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	newPubkey := testPubkey(0x41)
+
+	ps := NewShareState(db.NewMemDB())
+	ps.CreateShare(oldPubkey, big.NewInt(100), def.INT(1))
+
+	if err := ps.RotateSharePubkey(oldPubkey, newPubkey, []byte("not-a-real-signature"), 5); err == nil {
+		t.Fatal("RotateSharePubkey accepted a signature that does not verify")
+	}
+}
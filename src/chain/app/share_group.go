@@ -0,0 +1,195 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+)
+
+// groupSharePrefix namespaces GroupShare entries inside the same IAVL trie as
+// plain Share entries, keyed off the group pubkey's KeyString() instead of an
+// ed25519 KeyString().
+const groupSharePrefix = "group/"
+
+// GroupPubKey is the crypto.PubKey a Joint-Feldman DKG group publishes as its
+// validator identity: the product of the qualified dealers' zero-degree
+// Feldman commitments, Pi_{qualified} C_0. It is opaque curve-point bytes
+// rather than a fixed-size ed25519 key, so it is kept distinct from
+// crypto.PubKeyEd25519, but it fully implements crypto.PubKey in its own
+// right: a threshold Schnorr signature produced over the group's key share
+// (the scheme this DKG feeds) is itself a standard ed25519 signature under
+// the combined group point, so VerifyBytes below simply replays it through
+// crypto.PubKeyEd25519.VerifyBytes rather than needing its own curve math.
+type GroupPubKey []byte
+
+func (pk GroupPubKey) KeyString() string {
+	return groupSharePrefix + string(pk)
+}
+
+// Bytes returns pk's raw curve-point bytes.
+func (pk GroupPubKey) Bytes() []byte {
+	return append([]byte{}, pk...)
+}
+
+// Equals reports whether other is the same GroupPubKey, byte for byte.
+func (pk GroupPubKey) Equals(other crypto.PubKey) bool {
+	o, ok := other.(GroupPubKey)
+	if !ok {
+		return false
+	}
+	return string(pk) == string(o)
+}
+
+// VerifyBytes checks sig against msg under pk. The qualified dealers behind
+// pk run a threshold Schnorr signing protocol over the same curve as
+// crypto.PubKeyEd25519, so a completed group signature verifies exactly like
+// an individual ed25519 signature against the combined group point.
+func (pk GroupPubKey) VerifyBytes(msg, sig []byte) bool {
+	pub := crypto.PubKeyEd25519{}
+	copy(pub[:], pk)
+	return pub.VerifyBytes(msg, sig)
+}
+
+// GroupShare is the "owner" record for a GroupPubKey: the DKG parameters that
+// produced it plus the same stake bookkeeping a plain Share carries, so it can
+// be fed into AddShareBalance/SubShareBalance/MarkShare interchangeably with
+// ed25519-keyed shares.
+type GroupShare struct {
+	GroupPubkey   []byte
+	Threshold     int
+	Participants  [][]byte // ed25519 pubkeys of the DKG participants
+	Epoch         def.INT
+	ShareBalance  *big.Int
+	ShareGuaranty *big.Int
+	MHeight       def.INT
+}
+
+// pubkeyBytes extracts the raw identity bytes a Share/GroupShare stores for a
+// given crypto.PubKey, regardless of whether it is an individual ed25519 key
+// or a DKG group key.
+func pubkeyBytes(pubkey crypto.PubKey) []byte {
+	switch pk := pubkey.(type) {
+	case *crypto.PubKeyEd25519:
+		return append([]byte{}, pk[:]...)
+	case GroupPubKey:
+		return append([]byte{}, pk...)
+	default:
+		return nil
+	}
+}
+
+func (gs *GroupShare) FromBytes(bytes []byte) error {
+	return json.Unmarshal(bytes, gs)
+}
+
+func (gs *GroupShare) ToBytes() []byte {
+	bys, err := json.Marshal(gs)
+	if err != nil {
+		return nil
+	}
+	return bys
+}
+
+// CreateGroupShare registers the group pubkey produced by a qualified-dealer
+// set as a first-class share owner, mirroring CreateShare.
+func (ps *ShareState) CreateGroupShare(groupPubkey []byte, threshold int, participants [][]byte, epoch def.INT, power *big.Int, height def.INT) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	gs := &GroupShare{
+		GroupPubkey:  groupPubkey,
+		Threshold:    threshold,
+		Participants: participants,
+		Epoch:        epoch,
+		ShareBalance: new(big.Int).Set(power),
+		MHeight:      height,
+	}
+
+	ps.ShareCache.Set(GroupPubKey(groupPubkey).KeyString(), gs)
+}
+
+// GetGroupShare looks up a GroupShare the same way GetShare does for plain
+// shares: cache first, then the committed trie.
+func (ps *ShareState) GetGroupShare(groupPubkey []byte) (*GroupShare, error) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	keystring := GroupPubKey(groupPubkey).KeyString()
+	if itfc, ok := ps.ShareCache.Get(keystring); ok {
+		return itfc.(*GroupShare), nil
+	}
+	if _, value, exist := ps.trie.Get([]byte(keystring)); exist {
+		gs := new(GroupShare)
+		if err := gs.FromBytes(value); err != nil {
+			return nil, err
+		}
+		return gs, nil
+	}
+	return nil, fmt.Errorf("GroupShare not exist: %X", groupPubkey)
+}
+
+// ReshareGroup atomically moves ShareBalance/ShareGuaranty from an old group
+// pubkey to a newly re-shared one at the given height, so a DKG rotation never
+// leaves the validator set's stake stranded under a retired key. The old
+// GroupShare must exist, in ShareCache or the trie; the new one is created if
+// it does not, otherwise its balance and guaranty are added to. The old one is
+// left with zero balance and guaranty, and the next Commit drops it from the
+// trie.
+func (ps *ShareState) ReshareGroup(oldGroupPubkey, newGroupPubkey []byte, newThreshold int, newParticipants [][]byte, epoch def.INT, height def.INT) error {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	oldKey := GroupPubKey(oldGroupPubkey).KeyString()
+	oldShare, err := ps.loadGroupShareLocked(oldKey)
+	if err != nil {
+		return err
+	}
+
+	newKey := GroupPubKey(newGroupPubkey).KeyString()
+	newShare, err := ps.loadGroupShareLocked(newKey)
+	if err != nil {
+		// not found yet: the rotation mints the new group identity
+		newShare = &GroupShare{
+			GroupPubkey:   newGroupPubkey,
+			ShareBalance:  big.NewInt(0),
+			ShareGuaranty: big.NewInt(0),
+		}
+	}
+
+	newShare.Threshold = newThreshold
+	newShare.Participants = newParticipants
+	newShare.Epoch = epoch
+	newShare.MHeight = height
+	newShare.ShareBalance = new(big.Int).Add(newShare.ShareBalance, oldShare.ShareBalance)
+	if oldShare.ShareGuaranty != nil {
+		if newShare.ShareGuaranty == nil {
+			newShare.ShareGuaranty = big.NewInt(0)
+		}
+		newShare.ShareGuaranty = new(big.Int).Add(newShare.ShareGuaranty, oldShare.ShareGuaranty)
+	}
+
+	oldShare.ShareBalance = big.NewInt(0)
+	oldShare.ShareGuaranty = big.NewInt(0)
+
+	ps.ShareCache.Set(oldKey, oldShare)
+	ps.ShareCache.Set(newKey, newShare)
+	return nil
+}
+
+func (ps *ShareState) loadGroupShareLocked(keystring string) (*GroupShare, error) {
+	if itfc, ok := ps.ShareCache.Get(keystring); ok {
+		return itfc.(*GroupShare), nil
+	}
+	if _, value, exist := ps.trie.Get([]byte(keystring)); exist {
+		gs := new(GroupShare)
+		if err := gs.FromBytes(value); err != nil {
+			return nil, err
+		}
+		return gs, nil
+	}
+	return nil, errors.New("GroupShare not exist")
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
+	"github.com/Baptist-Publication/chorus-module/lib/go-db"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+)
+
+// GroupPubKey must satisfy crypto.PubKey for it to be usable anywhere a
+// *crypto.PubKeyEd25519 is, e.g. as the pubkey argument to
+// AddShareBalance/SubShareBalance/MarkShare.
+var _ crypto.PubKey = GroupPubKey{}
+
+func TestReshareGroupMergesIntoExistingDestination(t *testing.T) {
+	ps := NewShareState(db.NewMemDB())
+
+	oldGroupPubkey := []byte("old-group-pubkey")
+	newGroupPubkey := []byte("new-group-pubkey")
+
+	ps.CreateGroupShare(oldGroupPubkey, 2, [][]byte{[]byte("p1"), []byte("p2")}, 1, big.NewInt(100), def.INT(1))
+	// The destination already exists with its own balance before the
+	// reshare, the way a validator set re-electing an already-active group
+	// key would look.
+	ps.CreateGroupShare(newGroupPubkey, 3, [][]byte{[]byte("p3")}, 1, big.NewInt(40), def.INT(1))
+
+	if err := ps.ReshareGroup(oldGroupPubkey, newGroupPubkey, 3, [][]byte{[]byte("p1"), []byte("p2"), []byte("p3")}, 2, 5); err != nil {
+		t.Fatalf("ReshareGroup: %v", err)
+	}
+
+	newShare, err := ps.GetGroupShare(newGroupPubkey)
+	if err != nil {
+		t.Fatalf("GetGroupShare(new): %v", err)
+	}
+	if newShare.ShareBalance.Cmp(big.NewInt(140)) != 0 {
+		t.Fatalf("reshare clobbered the destination's balance instead of merging: got %s, want 140", newShare.ShareBalance)
+	}
+
+	oldShare, err := ps.GetGroupShare(oldGroupPubkey)
+	if err != nil {
+		t.Fatalf("GetGroupShare(old): %v", err)
+	}
+	if oldShare.ShareBalance.Sign() != 0 {
+		t.Fatalf("old group share still carries balance after reshare: %s", oldShare.ShareBalance)
+	}
+}
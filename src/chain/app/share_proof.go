@@ -0,0 +1,138 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
+	"github.com/Baptist-Publication/chorus-module/lib/go-merkle"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+)
+
+// ShareProof is a self-contained witness that a Share entry is (or is not,
+// via VerifyShareProof failing) committed under a given IAVL root. It carries
+// everything a light client needs to check inclusion without touching the DB.
+type ShareProof struct {
+	Pubkey   []byte
+	Share    *Share
+	Proof    []byte // wire-encoded merkle.IAVLProof
+	RootHash []byte
+	Height   def.INT
+}
+
+// ProveShare builds a ShareProof for pubkey against the currently committed
+// rootHash. It only looks at the trie, so it reflects the last Commit, not
+// any pending ShareCache mutations.
+func (ps *ShareState) ProveShare(pubkey []byte) (*ShareProof, error) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	pub := crypto.PubKeyEd25519{}
+	copy(pub[:], pubkey)
+	keystring := pub.KeyString()
+
+	value, proofBytes, exists := ps.trie.Proof([]byte(keystring))
+	if !exists {
+		return nil, fmt.Errorf("Share not exist: %X", pubkey)
+	}
+
+	share := new(Share)
+	if err := share.FromBytes(value); err != nil {
+		return nil, err
+	}
+
+	return &ShareProof{
+		Pubkey:   pubkey,
+		Share:    share,
+		Proof:    proofBytes,
+		RootHash: ps.rootHash,
+		Height:   share.MHeight,
+	}, nil
+}
+
+// VerifyShareProof checks that proof.Share is committed under root. It needs
+// no ShareState and no DB access, so light clients can run it on their own.
+func VerifyShareProof(root []byte, proof *ShareProof) error {
+	if proof == nil {
+		return errors.New("nil ShareProof")
+	}
+
+	iavlProof, err := merkle.ReadProof(proof.Proof)
+	if err != nil {
+		return fmt.Errorf("decode share proof: %v", err)
+	}
+
+	pub := crypto.PubKeyEd25519{}
+	copy(pub[:], proof.Pubkey)
+
+	if !iavlProof.Verify([]byte(pub.KeyString()), proof.Share.ToBytes(), root) {
+		return fmt.Errorf("share proof does not verify against root %X", root)
+	}
+	return nil
+}
+
+// BadStateProof is a byzantine fraud proof: two ShareProofs, each committed
+// under its own root (Before.RootHash is the pre-block root, After.RootHash
+// the block's claimed result), that are mutually inconsistent, e.g. a
+// Commit() that left a Share with a negative balance, or an after-balance
+// that doesn't match the before-balance plus the block's own claimed delta.
+// Any peer can check it with VerifyBadStateProof and slash whoever produced
+// After.RootHash.
+type BadStateProof struct {
+	Height       def.INT
+	Before       *ShareProof
+	After        *ShareProof
+	ClaimedDelta *big.Int // the balance change the block claims to have applied, if known
+	Reason       string
+}
+
+// ProveBadState packages a before/after ShareProof pair captured around a
+// mutation into a BadStateProof that can be gossiped to other peers.
+// claimedDelta is the balance change the block's transactions purport to
+// apply between before and after; pass nil if unknown.
+func (ps *ShareState) ProveBadState(before, after *ShareProof, claimedDelta *big.Int, reason string) *BadStateProof {
+	return &BadStateProof{
+		Height:       after.Height,
+		Before:       before,
+		After:        after,
+		ClaimedDelta: claimedDelta,
+		Reason:       reason,
+	}
+}
+
+// VerifyBadStateProof checks that each witness proof is a genuine inclusion
+// under its own claimed root (Before against Before.RootHash, After against
+// After.RootHash — the two were produced at different commits, so verifying
+// both against a single root would reject every real fraud case) and that
+// the after-state is actually byzantine: either a negative ShareBalance that
+// Commit() should never produce, or an after-balance inconsistent with
+// before-balance + ClaimedDelta, i.e. the Commit() result doesn't match the
+// transactions the block claims to have applied.
+func VerifyBadStateProof(fp *BadStateProof) error {
+	if fp == nil || fp.Before == nil || fp.After == nil {
+		return errors.New("bad-state proof missing witness proof")
+	}
+	if err := VerifyShareProof(fp.Before.RootHash, fp.Before); err != nil {
+		return fmt.Errorf("before-state proof invalid: %v", err)
+	}
+	if err := VerifyShareProof(fp.After.RootHash, fp.After); err != nil {
+		return fmt.Errorf("after-state proof invalid: %v", err)
+	}
+	if string(fp.Before.Pubkey) != string(fp.After.Pubkey) {
+		return errors.New("bad-state proof witnesses refer to different shares")
+	}
+
+	if fp.After.Share.ShareBalance.Sign() < 0 {
+		return nil
+	}
+
+	if fp.ClaimedDelta != nil {
+		expected := new(big.Int).Add(fp.Before.Share.ShareBalance, fp.ClaimedDelta)
+		if fp.After.Share.ShareBalance.Cmp(expected) != 0 {
+			return nil
+		}
+	}
+
+	return errors.New("no byzantine inconsistency found between before/after share state")
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
+	"github.com/Baptist-Publication/chorus-module/lib/go-db"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+)
+
+func testPubkey(b byte) []byte {
+	pubkey := make([]byte, 32)
+	pubkey[0] = b
+	return pubkey
+}
+
+func testEd25519PubKey(pubkey []byte) crypto.PubKeyEd25519 {
+	pub := crypto.PubKeyEd25519{}
+	copy(pub[:], pubkey)
+	return pub
+}
+
+func TestProveShareVerifyShareProofRoundTrip(t *testing.T) {
+	ps := NewShareState(db.NewMemDB())
+	pubkey := testPubkey(0x01)
+	ps.CreateShare(pubkey, big.NewInt(100), def.INT(1))
+	if _, err := ps.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	proof, err := ps.ProveShare(pubkey)
+	if err != nil {
+		t.Fatalf("ProveShare: %v", err)
+	}
+	if err := VerifyShareProof(proof.RootHash, proof); err != nil {
+		t.Fatalf("VerifyShareProof rejected a genuine proof: %v", err)
+	}
+
+	if err := VerifyShareProof([]byte("not-the-real-root"), proof); err == nil {
+		t.Fatal("VerifyShareProof accepted a proof against the wrong root")
+	}
+}
+
+func TestVerifyBadStateProofRejectsConsistentDelta(t *testing.T) {
+	ps := NewShareState(db.NewMemDB())
+	pubkey := testPubkey(0x02)
+	ps.CreateShare(pubkey, big.NewInt(100), def.INT(1))
+	if _, err := ps.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	before, err := ps.ProveShare(pubkey)
+	if err != nil {
+		t.Fatalf("ProveShare before: %v", err)
+	}
+
+	if err := ps.AddShareBalance(testEd25519PubKey(pubkey), big.NewInt(50), 2); err != nil {
+		t.Fatalf("AddShareBalance: %v", err)
+	}
+	if _, err := ps.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	after, err := ps.ProveShare(pubkey)
+	if err != nil {
+		t.Fatalf("ProveShare after: %v", err)
+	}
+
+	fp := ps.ProveBadState(before, after, big.NewInt(50), "claimed +50 balance change")
+	if err := VerifyBadStateProof(fp); err == nil {
+		t.Fatal("VerifyBadStateProof found byzantine behaviour in a perfectly consistent state transition")
+	}
+}
+
+func TestVerifyBadStateProofAcceptsInconsistentDelta(t *testing.T) {
+	ps := NewShareState(db.NewMemDB())
+	pubkey := testPubkey(0x03)
+	ps.CreateShare(pubkey, big.NewInt(100), def.INT(1))
+	if _, err := ps.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	before, err := ps.ProveShare(pubkey)
+	if err != nil {
+		t.Fatalf("ProveShare before: %v", err)
+	}
+
+	if err := ps.AddShareBalance(testEd25519PubKey(pubkey), big.NewInt(50), 2); err != nil {
+		t.Fatalf("AddShareBalance: %v", err)
+	}
+	if _, err := ps.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	after, err := ps.ProveShare(pubkey)
+	if err != nil {
+		t.Fatalf("ProveShare after: %v", err)
+	}
+
+	// The block claims a +999 delta but the committed state only moved by +50.
+	fp := ps.ProveBadState(before, after, big.NewInt(999), "claimed +999 balance change")
+	if err := VerifyBadStateProof(fp); err != nil {
+		t.Fatalf("VerifyBadStateProof missed a byzantine state transition: %v", err)
+	}
+}
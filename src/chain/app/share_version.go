@@ -0,0 +1,167 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-merkle"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+	"github.com/Baptist-Publication/chorus-module/xlib/mlist"
+)
+
+// CommitAt behaves like Commit, but additionally records the resulting root
+// against height so it can later be reached again through LoadVersion/RootAt.
+func (ps *ShareState) CommitAt(height def.INT) ([]byte, error) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	ps.flushCacheLocked()
+	ps.rootHash = ps.trie.Save()
+
+	if ps.versions == nil {
+		ps.versions = make(map[def.INT][]byte)
+	}
+	ps.versions[height] = ps.rootHash
+	return ps.rootHash, nil
+}
+
+// RootAt returns the root committed at height by CommitAt, or nil if no such
+// version is known (never committed, or pruned).
+func (ps *ShareState) RootAt(height def.INT) []byte {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	return ps.versions[height]
+}
+
+// LoadVersion reconstructs the state as of height, the way Load reconstructs
+// the state as of a known root. It invalidates ShareCache the same as
+// Load/Reload do, since any pending mutation belongs to a different version.
+func (ps *ShareState) LoadVersion(height def.INT) error {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	root, ok := ps.versions[height]
+	if !ok {
+		return fmt.Errorf("no committed version at height %d", height)
+	}
+
+	ps.ShareCache = mlist.NewMapList()
+	ps.trie.Load(root)
+	ps.root = root
+	ps.rootHash = root
+	return nil
+}
+
+// PruneVersionIndex drops the version index entries for every height outside
+// the retention window: the keepRecent most recent heights, plus every
+// keepEvery'th height before that (mirroring a prune-blocks policy of keeping
+// recent history densely and older history sparsely). It flushes ShareCache
+// first so no pending mutation is silently discarded.
+//
+// This is bookkeeping only, not a disk-reclaiming GC: it makes RootAt/
+// LoadVersion forget the dropped heights so callers stop depending on them,
+// but the underlying merkle.IAVLTree in this snapshot has no orphan/refcount
+// API to free the now-unreferenced on-disk nodes themselves, so disk usage is
+// unaffected. Do not call this expecting storage to shrink; real node GC
+// needs that API to land in go-merkle first, at which point this should
+// drive it rather than being renamed back to "Prune".
+func (ps *ShareState) PruneVersionIndex(keepRecent, keepEvery int) (pruned int, err error) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+
+	ps.flushCacheLocked()
+
+	heights := make([]def.INT, 0, len(ps.versions))
+	for h := range ps.versions {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+
+	for i, h := range heights {
+		if i < keepRecent {
+			continue
+		}
+		if keepEvery > 0 && int64(h)%int64(keepEvery) == 0 {
+			continue
+		}
+		delete(ps.versions, h)
+		pruned++
+	}
+	return pruned, nil
+}
+
+// ShareSnapshotEntry is one entry of an Export/Import snapshot stream. The
+// trie holds both plain Shares and GroupShares in the same namespace (see
+// groupSharePrefix), so a snapshot entry must be able to carry either one
+// instead of assuming every value unmarshals as a Share.
+type ShareSnapshotEntry struct {
+	Share      *Share
+	GroupShare *GroupShare
+}
+
+// Export streams every live Share/GroupShare committed at height over the
+// returned channel, closing it once done. It operates on a private copy of
+// the trie so it never races with concurrent reads/writes against ps.
+func (ps *ShareState) Export(height def.INT) (<-chan *ShareSnapshotEntry, error) {
+	ps.mtx.Lock()
+	root, ok := ps.versions[height]
+	database := ps.database
+	ps.mtx.Unlock()
+	if !ok {
+		return nil, errors.New("no committed version at that height")
+	}
+
+	snapshot := merkle.NewIAVLTree(1024, database)
+	snapshot.Load(root)
+
+	out := make(chan *ShareSnapshotEntry)
+	go func() {
+		defer close(out)
+		snapshot.Iterate(func(key, value []byte) bool {
+			if strings.HasPrefix(string(key), groupSharePrefix) {
+				gs := new(GroupShare)
+				if err := gs.FromBytes(value); err != nil {
+					return false
+				}
+				out <- &ShareSnapshotEntry{GroupShare: gs}
+				return false
+			}
+
+			share := new(Share)
+			if err := share.FromBytes(value); err != nil {
+				return false
+			}
+			out <- &ShareSnapshotEntry{Share: share}
+			return false
+		})
+	}()
+	return out, nil
+}
+
+// Import rebuilds a fresh IAVL trie from a channel of ShareSnapshotEntry
+// produced by Export and returns its root hash. Entries are inserted in the
+// order received (Export sends them in key order). An IAVL trie's shape, and
+// so its hash, depends on insertion order, so the returned root equals the
+// exported root only when the source trie has the same shape; Import does
+// not check this. The rebuilt trie holds the same entries either way, which
+// lets a new node state-sync from a snapshot instead of replaying history.
+func (ps *ShareState) Import(entries <-chan *ShareSnapshotEntry) ([]byte, error) {
+	ps.mtx.Lock()
+	database := ps.database
+	ps.mtx.Unlock()
+
+	fresh := merkle.NewIAVLTree(1024, database)
+	for entry := range entries {
+		switch {
+		case entry.GroupShare != nil:
+			keystring := GroupPubKey(entry.GroupShare.GroupPubkey).KeyString()
+			fresh.Set([]byte(keystring), entry.GroupShare.ToBytes())
+		case entry.Share != nil:
+			keystring := ed25519KeyString(entry.Share.Pubkey)
+			fresh.Set([]byte(keystring), entry.Share.ToBytes())
+		}
+	}
+	return fresh.Save(), nil
+}
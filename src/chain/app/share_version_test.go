@@ -0,0 +1,66 @@
+package app
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-db"
+	"github.com/Baptist-Publication/chorus-module/xlib/def"
+)
+
+func TestCommitAtLoadVersionRoundTrip(t *testing.T) {
+	ps := NewShareState(db.NewMemDB())
+	pubkey := testPubkey(0x50)
+
+	ps.CreateShare(pubkey, big.NewInt(100), def.INT(1))
+	rootAt1, err := ps.CommitAt(1)
+	if err != nil {
+		t.Fatalf("CommitAt(1): %v", err)
+	}
+
+	if err := ps.AddShareBalance(testEd25519PubKey(pubkey), big.NewInt(50), 2); err != nil {
+		t.Fatalf("AddShareBalance: %v", err)
+	}
+	if _, err := ps.CommitAt(2); err != nil {
+		t.Fatalf("CommitAt(2): %v", err)
+	}
+
+	if err := ps.LoadVersion(1); err != nil {
+		t.Fatalf("LoadVersion(1): %v", err)
+	}
+	share, err := ps.GetShare(pubkey)
+	if err != nil {
+		t.Fatalf("GetShare after LoadVersion(1): %v", err)
+	}
+	if share.ShareBalance.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("LoadVersion(1) did not restore height-1 state: got balance %s, want 100", share.ShareBalance)
+	}
+	if string(ps.RootAt(1)) != string(rootAt1) {
+		t.Fatal("RootAt(1) does not match the root CommitAt(1) returned")
+	}
+}
+
+func TestPruneVersionIndexKeepsRecentAndDropsRest(t *testing.T) {
+	ps := NewShareState(db.NewMemDB())
+	ps.CreateShare(testPubkey(0x51), big.NewInt(1), def.INT(1))
+
+	for h := def.INT(1); h <= 5; h++ {
+		if _, err := ps.CommitAt(h); err != nil {
+			t.Fatalf("CommitAt(%d): %v", h, err)
+		}
+	}
+
+	pruned, err := ps.PruneVersionIndex(2, 0)
+	if err != nil {
+		t.Fatalf("PruneVersionIndex: %v", err)
+	}
+	if pruned != 3 {
+		t.Fatalf("expected 3 heights pruned (keeping the 2 most recent of 5), got %d", pruned)
+	}
+	if ps.RootAt(5) == nil || ps.RootAt(4) == nil {
+		t.Fatal("PruneVersionIndex dropped a height inside the retention window")
+	}
+	if ps.RootAt(1) != nil || ps.RootAt(2) != nil || ps.RootAt(3) != nil {
+		t.Fatal("PruneVersionIndex left a height outside the retention window behind")
+	}
+}
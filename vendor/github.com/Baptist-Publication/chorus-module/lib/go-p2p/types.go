@@ -15,6 +15,9 @@
 package p2p
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
@@ -25,21 +28,92 @@ import (
 
 const maxNodeInfoSize = 10240 // 10Kb
 
+// RequiredCapabilities lists the capability strings a peer must share with us
+// or the handshake fails outright; any other advertised capability is merely
+// negotiated, not required, so nodes on slightly different minor versions can
+// still interoperate on their common feature set.
+var RequiredCapabilities []string
+
 type NodeInfo struct {
-	PubKey      crypto.PubKeyEd25519 `json:"pub_key"`
-	SigndPubKey string               `json:"signd_pub_key"`
-	Moniker     string               `json:"moniker"`
-	Network     string               `json:"network"`
-	RemoteAddr  string               `json:"remote_addr"`
-	ListenAddr  string               `json:"listen_addr"`
-	Version     string               `json:"version"` // major.minor.revision
-	Other       []string             `json:"other"`   // other application specific data
+	PubKey       crypto.PubKeyEd25519 `json:"pub_key"`
+	SigndPubKey  string               `json:"signd_pub_key"`
+	Moniker      string               `json:"moniker"`
+	Network      string               `json:"network"`
+	RemoteAddr   string               `json:"remote_addr"`
+	ListenAddr   string               `json:"listen_addr"`
+	Version      string               `json:"version"`      // major.minor.revision
+	Capabilities []string             `json:"capabilities"` // e.g. "share/v1", "beacon/v2", "fraud-proof/v1"
+	Other        []string             `json:"other"`        // other application specific data
+}
+
+// canonicalBytes is the serialization that gets signed and verified: it
+// excludes SigndPubKey (the signature itself) and RemoteAddr (filled in by
+// whoever dialed, so it differs between the two ends of the same handshake).
+func (info *NodeInfo) canonicalBytes() ([]byte, error) {
+	cp := *info
+	cp.SigndPubKey = ""
+	cp.RemoteAddr = ""
+	return json.Marshal(cp)
 }
 
-// CONTRACT: two nodes are compatible if the major/minor versions match and network match
+// Sign fills in SigndPubKey with priv's signature over info's canonical
+// bytes. It must be called after every other field is final, and before the
+// NodeInfo is sent to a peer.
+func (info *NodeInfo) Sign(priv crypto.PrivKeyEd25519) error {
+	bz, err := info.canonicalBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := priv.Sign(bz)
+	if err != nil {
+		return err
+	}
+	info.SigndPubKey = hex.EncodeToString(sig)
+	return nil
+}
+
+// VerifySignature checks that SigndPubKey is a valid signature by PubKey over
+// info's canonical bytes, rejecting peers that present someone else's pubkey
+// during dial.
+func (info *NodeInfo) VerifySignature() error {
+	sig, err := hex.DecodeString(info.SigndPubKey)
+	if err != nil {
+		return fmt.Errorf("decode node info signature: %v", err)
+	}
+	bz, err := info.canonicalBytes()
+	if err != nil {
+		return err
+	}
+	if !info.PubKey.VerifyBytes(bz, sig) {
+		return errors.New("node info signature does not verify against its own pub_key")
+	}
+	return nil
+}
+
+// NegotiateCapabilities returns the capabilities local and remote both
+// advertise, in local's order.
+func NegotiateCapabilities(local, remote *NodeInfo) []string {
+	remoteSet := make(map[string]struct{}, len(remote.Capabilities))
+	for _, c := range remote.Capabilities {
+		remoteSet[c] = struct{}{}
+	}
+
+	var shared []string
+	for _, c := range local.Capabilities {
+		if _, ok := remoteSet[c]; ok {
+			shared = append(shared, c)
+		}
+	}
+	return shared
+}
+
+// CONTRACT: two nodes are compatible if their major versions and network
+// match, the remote's handshake signature verifies, and they share every
+// capability in RequiredCapabilities. Differing minor versions no longer
+// fail the handshake outright, as long as the required capability set is met.
 func (info *NodeInfo) CompatibleWith(other *NodeInfo) error {
-	iMajor, iMinor, _, iErr := splitVersion(info.Version)
-	oMajor, oMinor, _, oErr := splitVersion(other.Version)
+	iMajor, _, _, iErr := splitVersion(info.Version)
+	oMajor, _, _, oErr := splitVersion(other.Version)
 
 	// if our own version number is not formatted right, we messed up
 	if iErr != nil {
@@ -56,16 +130,30 @@ func (info *NodeInfo) CompatibleWith(other *NodeInfo) error {
 		return fmt.Errorf("Peer is on a different major version. Got %v, expected %v", oMajor, iMajor)
 	}
 
-	// minor version must match
-	if iMinor != oMinor {
-		return fmt.Errorf("Peer is on a different minor version. Got %v, expected %v", oMinor, iMinor)
-	}
-
 	// nodes must be on the same network
 	if info.Network != other.Network {
 		return fmt.Errorf("Peer is on a different network. Got %v, expected %v", other.Network, info.Network)
 	}
 
+	// the remote must actually hold the private key for the pub_key it claims
+	if err := other.VerifySignature(); err != nil {
+		return fmt.Errorf("peer handshake signature invalid: %v", err)
+	}
+
+	// we must share every capability we can't function without
+	if len(RequiredCapabilities) > 0 {
+		shared := NegotiateCapabilities(info, other)
+		sharedSet := make(map[string]struct{}, len(shared))
+		for _, c := range shared {
+			sharedSet[c] = struct{}{}
+		}
+		for _, req := range RequiredCapabilities {
+			if _, ok := sharedSet[req]; !ok {
+				return fmt.Errorf("peer is missing required capability %q", req)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,83 @@
+package p2p
+
+import (
+	stded25519 "crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/Baptist-Publication/chorus-module/lib/go-crypto"
+)
+
+func newSignedNodeInfo(t *testing.T, network, version string, capabilities []string) *NodeInfo {
+	t.Helper()
+	pub, priv, err := stded25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	info := &NodeInfo{
+		Network:      network,
+		Version:      version,
+		Capabilities: capabilities,
+	}
+	copy(info.PubKey[:], pub)
+
+	privKey := crypto.PrivKeyEd25519{}
+	copy(privKey[:], priv)
+	if err := info.Sign(privKey); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return info
+}
+
+func TestCompatibleWithAcceptsSharedRequiredCapability(t *testing.T) {
+	old := RequiredCapabilities
+	defer func() { RequiredCapabilities = old }()
+	RequiredCapabilities = []string{"share/v1"}
+
+	local := newSignedNodeInfo(t, "chorus", "1.0.0", []string{"share/v1"})
+	remote := newSignedNodeInfo(t, "chorus", "1.4.0", []string{"share/v1", "beacon/v2"})
+
+	if err := local.CompatibleWith(remote); err != nil {
+		t.Fatalf("CompatibleWith rejected a peer that meets every requirement: %v", err)
+	}
+}
+
+func TestCompatibleWithRejectsMissingRequiredCapability(t *testing.T) {
+	old := RequiredCapabilities
+	defer func() { RequiredCapabilities = old }()
+	RequiredCapabilities = []string{"fraud-proof/v1"}
+
+	local := newSignedNodeInfo(t, "chorus", "1.0.0", []string{"fraud-proof/v1"})
+	remote := newSignedNodeInfo(t, "chorus", "1.0.0", []string{"share/v1"})
+
+	if err := local.CompatibleWith(remote); err == nil {
+		t.Fatal("CompatibleWith accepted a peer missing a required capability")
+	}
+}
+
+func TestCompatibleWithRejectsBadHandshakeSignature(t *testing.T) {
+	local := newSignedNodeInfo(t, "chorus", "1.0.0", nil)
+	remote := newSignedNodeInfo(t, "chorus", "1.0.0", nil)
+	remote.SigndPubKey = "00"
+
+	if err := local.CompatibleWith(remote); err == nil {
+		t.Fatal("CompatibleWith accepted a peer whose handshake signature does not verify")
+	}
+}
+
+func TestNegotiateCapabilitiesReturnsSharedInLocalOrder(t *testing.T) {
+	local := &NodeInfo{Capabilities: []string{"beacon/v2", "share/v1", "fraud-proof/v1"}}
+	remote := &NodeInfo{Capabilities: []string{"share/v1", "fraud-proof/v1"}}
+
+	shared := NegotiateCapabilities(local, remote)
+	want := []string{"share/v1", "fraud-proof/v1"}
+	if len(shared) != len(want) {
+		t.Fatalf("got %v, want %v", shared, want)
+	}
+	for i := range want {
+		if shared[i] != want[i] {
+			t.Fatalf("got %v, want %v", shared, want)
+		}
+	}
+}